@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"math/rand/v2"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // 2.1 Variable shadowing
@@ -54,6 +65,27 @@ func solveShadow(cond bool) {
 	log.Println(client)
 }
 
+// or assign through a pointer, so there is no := in the branch to shadow with
+// returns the error, so the caller still decides how to handle it
+func Assign[T any](dst *T, fn func() (T, error)) error {
+	v, err := fn()
+	if err != nil {
+		return err
+	}
+	*dst = v
+	return nil
+}
+
+// same as Assign but panics on error
+// only for init-time code where there is no caller to return the error to (see 2.3)
+// everywhere else prefer Assign
+// panics with a wrapped error, so a recover can still use errors.Is/As
+func MustAssign[T any](dst *T, fn func() (T, error)) {
+	if err := Assign(dst, fn); err != nil {
+		panic(fmt.Errorf("MustAssign: %w", err))
+	}
+}
+
 // 2.2 Unnecessary nested code
 // allign happy path to the left and error handling to the right
 // use early returns
@@ -142,6 +174,157 @@ func runScrape() {
 // 2.8 any says nothing
 // ...
 
+// 2.9 Being confused about when to use generics
+// (good) data structures and functions working on slices, maps, channels of any type
+// (bad) when just calling a method of the type argument, use the interface directly
+// preallocate the result when the final length is known (or bounded)
+// nil in, nil out (see 3.6)
+func Map[T, U any](s []T, f func(T) U) []U {
+	if s == nil {
+		return nil
+	}
+
+	res := make([]U, len(s))
+	for i, v := range s {
+		res[i] = f(v)
+	}
+	return res
+}
+
+// the result can't be longer than s, so len(s) avoids any regrowth
+// but if only a few items match, the result keeps a big backing array (see sliceLeaks/otherLeaks)
+// pass it through TrimCap if it is kept around for long
+// nil in, nil out, like Map
+func Filter[T any](s []T, keep func(T) bool) []T {
+	if s == nil {
+		return nil
+	}
+
+	res := make([]T, 0, len(s))
+	for _, v := range s {
+		if keep(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func Reduce[T, U any](s []T, init U, f func(U, T) U) U {
+	acc := init
+	for _, v := range s {
+		acc = f(acc, v)
+	}
+	return acc
+}
+
+// 2.11 Not using the functional options pattern
+// an unexported config struct + exported option funcs that mutate it
+// defaults live in one place and new options don't break callers
+// (example) a generic retry helper
+type retryConfig struct {
+	maxAttempts int
+	delay       time.Duration
+	maxDelay    time.Duration
+	jitter      bool
+	retryOn     func(error) bool
+}
+
+type RetryOption func(*retryConfig)
+
+// n < 1 is clamped to 1, fn always runs at least once
+func WithMaxAttempts(n int) RetryOption {
+	return func(c *retryConfig) {
+		c.maxAttempts = max(n, 1)
+	}
+}
+
+// base delay, doubled after every failed attempt
+// negative values are clamped to 0 (retry right away)
+func WithBackoff(d time.Duration) RetryOption {
+	return func(c *retryConfig) {
+		c.delay = max(d, 0)
+	}
+}
+
+// caps every single wait, whatever the attempt count, <= 0 means no cap
+// WithMaxAttempts still bounds the number of waits, so the worst case total
+// wait is about (maxAttempts-1) * d
+func WithMaxDelay(d time.Duration) RetryOption {
+	return func(c *retryConfig) {
+		c.maxDelay = d
+	}
+}
+
+// wait a random duration in [0, delay) instead of the full delay
+// applied after WithMaxDelay, so the jittered wait stays within the cap
+func WithJitter() RetryOption {
+	return func(c *retryConfig) {
+		c.jitter = true
+	}
+}
+
+// only retry errors for which f returns true, return the others right away
+// nil keeps the default (retry every error)
+func WithRetryOn(f func(error) bool) RetryOption {
+	return func(c *retryConfig) {
+		if f != nil {
+			c.retryOn = f
+		}
+	}
+}
+
+// doubles delay without overflowing, then clamps it to maxDelay (if > 0)
+func nextDelay(delay, maxDelay time.Duration) time.Duration {
+	if delay > math.MaxInt64/2 {
+		delay = math.MaxInt64
+	} else {
+		delay *= 2
+	}
+	if maxDelay > 0 {
+		delay = min(delay, maxDelay)
+	}
+	return delay
+}
+
+func Retry(ctx context.Context, fn func() error, opts ...RetryOption) error {
+	cfg := retryConfig{
+		maxAttempts: 3,
+		delay:       100 * time.Millisecond,
+		retryOn:     func(error) bool { return true },
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	delay := cfg.delay
+	if cfg.maxDelay > 0 {
+		delay = min(delay, cfg.maxDelay)
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.maxAttempts || !cfg.retryOn(err) {
+			return err
+		}
+
+		wait := delay
+		if cfg.jitter && delay > 0 {
+			wait = time.Duration(rand.Int64N(int64(delay)))
+		}
+		// not time.After, it would keep the timer alive until it fires
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+		delay = nextDelay(delay, cfg.maxDelay)
+	}
+}
+
 // 3.2.3 Detecting integer overflows during addition
 func add(x, y int) (int, error) {
 	if x > math.MaxInt-y {
@@ -296,8 +479,7 @@ func otherLeaks() []foo {
 	}
 
 	// either do this if the slice is small enough
-	keep := make([]foo, 2)
-	copy(keep, foos[:2])
+	keep := TrimCap(foos[:2])
 
 	// or if slice is big enough, set the unwanted data to nil
 	for i := 2; i <= len(foos); i++ {
@@ -307,6 +489,375 @@ func otherLeaks() []foo {
 	return keep
 }
 
+// TrimCap returns a copy of s with cap == len, so the backing array of s
+// (and everything it references) can be garbage collected
+// costs one allocation + copy, so use it only for slices that are kept around
+// for a long time, not for short lived ones
+func TrimCap[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+
+	trimmed := make([]T, len(s))
+	copy(trimmed, s)
+	return trimmed
+}
+
+// 5 Strings
+// a string (or []byte) is just bytes, it is not guaranteed to be valid UTF-8
+// ranging over invalid bytes yields utf8.RuneError, and decoders may reject them
+// so validate data coming from the outside before parsing it
+type utf8Config struct {
+	replacement []byte
+}
+
+type UTF8Option func(*utf8Config)
+
+// drop invalid sequences instead of replacing them with U+FFFD
+func WithDropInvalid() UTF8Option {
+	return func(c *utf8Config) {
+		c.replacement = nil
+	}
+}
+
+// returns b untouched (no allocation) when it is already valid
+// a run of consecutive invalid bytes is replaced by a single U+FFFD
+func EnsureUTF8(b []byte, opts ...UTF8Option) []byte {
+	if utf8.Valid(b) {
+		return b
+	}
+
+	cfg := utf8Config{replacement: []byte(string(utf8.RuneError))}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return bytes.ToValidUTF8(b, cfg.replacement)
+}
+
+// masks secrets before a URL or header ends up in a log line or an error
+// regexps are compiled once, not on every call
+var (
+	secretParamRe = regexp.MustCompile(`(?i)([?&](?:apikey|token|mailto)=)[^&#\s]*`)
+	authHeaderRe  = regexp.MustCompile(`(?i)(authorization:\s*)[^\r\n]*`)
+)
+
+func redact(s string) string {
+	s = secretParamRe.ReplaceAllString(s, "${1}***")
+	return authHeaderRe.ReplaceAllString(s, "${1}***")
+}
+
+// merges author lists, treating "J. Smith" and "John Smith" as the same person
+// (same surname, every given name is an initial/prefix of the other one)
+// keeps the most complete spelling at the position of the first occurrence
+// "Smith" alone is never merged with "John Smith", it's too ambiguous
+func MergeAuthors(lists ...[]string) []string {
+	type author struct {
+		name    string
+		surname string
+		given   []string
+	}
+
+	var merged []author
+	for _, list := range lists {
+		for _, name := range list {
+			name = strings.Join(strings.Fields(name), " ")
+			if name == "" {
+				continue
+			}
+			surname, given := splitName(name)
+
+			found := false
+			for i := range merged {
+				a := &merged[i]
+				if a.surname != surname || !sameGivenNames(a.given, given) {
+					continue
+				}
+				if nameLetters(name) > nameLetters(a.name) {
+					a.name, a.given = name, given
+				}
+				found = true
+				break
+			}
+			if !found {
+				merged = append(merged, author{name: name, surname: surname, given: given})
+			}
+		}
+	}
+
+	return Map(merged, func(a author) string { return a.name })
+}
+
+// handles both "John Smith" and "Smith, John", lowercased and without dots
+func splitName(name string) (surname string, given []string) {
+	name = strings.ToLower(strings.ReplaceAll(name, ".", " "))
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return strings.TrimSpace(last), strings.Fields(first)
+	}
+
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[len(fields)-1], fields[:len(fields)-1]
+}
+
+func sameGivenNames(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	for i := 0; i < min(len(a), len(b)); i++ {
+		if !strings.HasPrefix(a[i], b[i]) && !strings.HasPrefix(b[i], a[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func nameLetters(name string) int {
+	n := 0
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// appends s to dst without the hyphens and spaces, with a check digit 'x' uppercased
+// no allocation when dst has enough capacity, e.g.
+//
+//	var buf [13]byte
+//	isbn := normalizeISBN(buf[:0], "978-0-13-419044-0")
+//
+// strings.ReplaceAll allocates a new string for every separator kind it finds
+// it doesn't validate anything, that's the caller's job
+func normalizeISBN(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '-', ' ':
+		case 'x':
+			dst = append(dst, 'X')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// trims, collapses any run of whitespace (\n, \t, NBSP, ...) into a single space
+// and drops the other control chars, hyphens and other punctuation are kept
+// ranges over runes, not bytes, so multi-byte chars stay intact
+func sanitizeString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	pendingSpace := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			pendingSpace = b.Len() > 0
+		case unicode.IsControl(r):
+		default:
+			if pendingSpace {
+				b.WriteByte(' ')
+				pendingSpace = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// separators that always mean a new author
+var authorSepRe = regexp.MustCompile(`(?i);|\s+and\s+|\s+&\s+`)
+
+// splits "A. Smith; B. Jones and C. Lee" into one name per author
+// "," is ambiguous: "Smith, John" is one author, "A. Smith, B. Jones" are two
+// so a single word before a comma is taken as a surname followed by its given names
+// and suffixes like "Jr." stay attached to the name before them
+func SplitAuthors(raw string) []string {
+	var authors []string
+	for _, chunk := range authorSepRe.Split(raw, -1) {
+		var parts []string
+		for _, part := range strings.Split(chunk, ",") {
+			if part = sanitizeString(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		for i := 0; i < len(parts); i++ {
+			name := parts[i]
+			if !strings.Contains(name, " ") && i+1 < len(parts) {
+				name += ", " + parts[i+1]
+				i++
+			}
+			if i+1 < len(parts) && isNameSuffix(parts[i+1]) {
+				name += ", " + parts[i+1]
+				i++
+			}
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+func isNameSuffix(s string) bool {
+	switch strings.ToLower(strings.TrimSuffix(s, ".")) {
+	case "jr", "sr", "ii", "iii", "iv":
+		return true
+	}
+	return false
+}
+
+// 9 Concurrency: bounded worker pool
+// a fixed number of workers read from in and write to out
+// every channel operation also selects on ctx.Done(), so on cancellation
+// no goroutine stays blocked on a full or empty channel
+// out is closed once all workers have exited, so ranging over Results() never leaks
+// out only buffers `workers` results, so Results() must be read concurrently with
+// Submit (e.g. submit from another goroutine), otherwise once the buffer is full
+// every worker blocks on out and Submit blocks until ctx is cancelled
+// a panic in fn is recovered (see PanicError), so one bad item doesn't crash
+// the whole process, that item just has no result
+type Pool[In, Out any] struct {
+	ctx context.Context
+	in  chan In
+	out chan Out
+	wg  sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// what a recovered panic turns into, keeps the stack of the panicking goroutine
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// workers < 1 is clamped to 1, with 0 workers nothing would ever read in
+func NewPool[In, Out any](ctx context.Context, workers int, fn func(context.Context, In) Out) *Pool[In, Out] {
+	workers = max(workers, 1)
+	p := &Pool[In, Out]{
+		ctx: ctx,
+		in:  make(chan In),
+		out: make(chan Out, workers),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case v, ok := <-p.in:
+					if !ok {
+						return
+					}
+					r, err := safeCall(ctx, fn, v)
+					if err != nil {
+						p.mu.Lock()
+						p.errs = append(p.errs, err)
+						p.mu.Unlock()
+						continue
+					}
+					select {
+					case p.out <- r:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		p.wg.Wait()
+		close(p.out)
+	}()
+
+	return p
+}
+
+// returns false if ctx was cancelled before a worker picked v up
+// must not be called after Close
+func (p *Pool[In, Out]) Submit(v In) bool {
+	select {
+	case p.in <- v:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// no more Submit calls, workers exit after finishing the pending work
+func (p *Pool[In, Out]) Close() {
+	close(p.in)
+}
+
+func (p *Pool[In, Out]) Results() <-chan Out {
+	return p.out
+}
+
+// the recovered panics joined together, nil if there were none
+// only complete once Results() is closed
+func (p *Pool[In, Out]) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(p.errs...)
+}
+
+// the named result lets the deferred recover set err
+func safeCall[In, Out any](ctx context.Context, fn func(context.Context, In) Out, v In) (out Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx, v), nil
+}
+
+// smoothed latency estimate (exponentially weighted moving average)
+// value = alpha*sample + (1-alpha)*value, a higher alpha reacts faster but is noisier
+// guarded by a mutex, so concurrent workers can feed the same tracker
+type EWMA struct {
+	mu    sync.Mutex
+	alpha float64
+	value float64
+	set   bool
+}
+
+// alpha outside (0, 1] falls back to 0.1
+func NewEWMA(alpha float64) *EWMA {
+	if !(alpha > 0 && alpha <= 1) {
+		alpha = 0.1
+	}
+	return &EWMA{alpha: alpha}
+}
+
+// the first sample is taken as is, so the estimate doesn't start from 0
+func (e *EWMA) Add(sample time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.set {
+		e.value, e.set = float64(sample), true
+		return
+	}
+	e.value = e.alpha*float64(sample) + (1-e.alpha)*e.value
+}
+
+// 0 until the first sample
+func (e *EWMA) Value() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.value)
+}
+
 func main() {
 	// solveShadow(true)
 	// runScrape()
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTrimCap(t *testing.T) {
+	s := make([]int, 3, 100)
+	s[0], s[1], s[2] = 1, 2, 3
+
+	got := TrimCap(s)
+	if len(got) != len(s) || cap(got) != len(got) {
+		t.Fatalf("len=%d cap=%d, want len=cap=%d", len(got), cap(got), len(s))
+	}
+	for i := range s {
+		if got[i] != s[i] {
+			t.Fatalf("got[%d]=%d, want %d", i, got[i], s[i])
+		}
+	}
+
+	// the copy must not share the backing array
+	got[0] = 42
+	if s[0] != 1 {
+		t.Fatal("TrimCap result aliases the input")
+	}
+
+	if TrimCap([]int(nil)) != nil {
+		t.Fatal("TrimCap(nil) should stay nil")
+	}
+}
+
+func TestMap(t *testing.T) {
+	got := Map([]int{1, 2, 3}, func(i int) string { return strconv.Itoa(i * 2) })
+	if !slices.Equal(got, []string{"2", "4", "6"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	if Map([]int(nil), strconv.Itoa) != nil {
+		t.Fatal("Map(nil) should return nil")
+	}
+	if got := Map([]int{}, strconv.Itoa); got == nil || len(got) != 0 {
+		t.Fatalf("Map(empty) = %#v, want empty non-nil", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	got := Filter([]int{1, 2, 3, 4, 5}, func(i int) bool { return i%2 == 1 })
+	if !slices.Equal(got, []int{1, 3, 5}) {
+		t.Fatalf("got %v", got)
+	}
+
+	if got := Filter([]int{1, 2}, func(int) bool { return false }); len(got) != 0 {
+		t.Fatalf("got %v, want empty", got)
+	}
+
+	if Filter([]int(nil), func(int) bool { return true }) != nil {
+		t.Fatal("Filter(nil) should return nil")
+	}
+}
+
+func TestReduce(t *testing.T) {
+	sum := Reduce([]int{1, 2, 3, 4}, 0, func(acc, i int) int { return acc + i })
+	if sum != 10 {
+		t.Fatalf("sum = %d, want 10", sum)
+	}
+
+	joined := Reduce([]int{1, 2, 3}, "", func(acc string, i int) string { return acc + strconv.Itoa(i) })
+	if joined != "123" {
+		t.Fatalf("joined = %q, want %q", joined, "123")
+	}
+
+	if got := Reduce(nil, 7, func(acc, i int) int { return acc + i }); got != 7 {
+		t.Fatalf("Reduce(nil) = %d, want init value 7", got)
+	}
+}
+
+func BenchmarkMap(b *testing.B) {
+	s := make([]int, 10_000)
+	for i := range s {
+		s[i] = i
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = Map(s, func(i int) int { return i * 2 })
+	}
+}
+
+func TestAssign(t *testing.T) {
+	var v string
+	if err := Assign(&v, func() (string, error) { return "ok", nil }); err != nil || v != "ok" {
+		t.Fatalf("v=%q err=%v", v, err)
+	}
+
+	errBoom := errors.New("boom")
+	if err := Assign(&v, func() (string, error) { return "ignored", errBoom }); !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v, want %v", err, errBoom)
+	}
+	if v != "ok" {
+		t.Fatalf("dst changed on error: %q", v)
+	}
+}
+
+func TestMustAssignPanicsOnError(t *testing.T) {
+	errBoom := errors.New("boom")
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("MustAssign did not panic")
+		}
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, errBoom) {
+			t.Fatalf("recovered %v, want an error wrapping %v", r, errBoom)
+		}
+	}()
+
+	var v int
+	MustAssign(&v, func() (int, error) { return 0, errBoom })
+}
+
+func TestMustAssign(t *testing.T) {
+	var v int
+	MustAssign(&v, func() (int, error) { return 42, nil })
+	if v != 42 {
+		t.Fatalf("v = %d, want 42", v)
+	}
+}
+
+func TestPool(t *testing.T) {
+	p := NewPool(context.Background(), 3, func(_ context.Context, i int) int { return i * 2 })
+	go func() {
+		for i := 0; i < 100; i++ {
+			p.Submit(i)
+		}
+		p.Close()
+	}()
+
+	sum := 0
+	for r := range p.Results() {
+		sum += r
+	}
+	if sum != 9900 {
+		t.Fatalf("sum = %d, want 9900", sum)
+	}
+	if err := p.Err(); err != nil {
+		t.Fatalf("Err() = %v, want nil", err)
+	}
+}
+
+func TestPoolClampsWorkers(t *testing.T) {
+	for _, workers := range []int{0, -1} {
+		p := NewPool(context.Background(), workers, func(_ context.Context, i int) int { return i })
+		go func() {
+			p.Submit(1)
+			p.Close()
+		}()
+
+		select {
+		case r, ok := <-p.Results():
+			if !ok || r != 1 {
+				t.Fatalf("workers=%d: got %d, %t", workers, r, ok)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("workers=%d: no result", workers)
+		}
+	}
+}
+
+func TestPoolCancelMidFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const workers = 4
+	var inFlight sync.WaitGroup
+	started := make(chan struct{}, workers)
+	p := NewPool(ctx, workers, func(ctx context.Context, i int) int {
+		defer inFlight.Done()
+		started <- struct{}{}
+		<-ctx.Done()
+		return i
+	})
+
+	// keep every worker busy, then cancel while they are blocked in fn
+	inFlight.Add(workers)
+	for i := 0; i < workers; i++ {
+		if !p.Submit(i) {
+			t.Fatalf("Submit(%d) failed before cancel", i)
+		}
+	}
+	for i := 0; i < workers; i++ {
+		<-started
+	}
+	cancel()
+
+	if p.Submit(workers) {
+		t.Fatal("Submit succeeded after cancel")
+	}
+
+	// ranging over Results() must end: workers exited and out was closed
+	done := make(chan struct{})
+	go func() {
+		for range p.Results() {
+		}
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("workers did not exit after cancel")
+	}
+}
+
+// fails n times, then succeeds
+func failingFn(n int, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= n {
+			return errors.New("fail")
+		}
+		return nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), failingFn(2, &calls), WithBackoff(time.Millisecond), WithMaxAttempts(5))
+	if err != nil || calls != 3 {
+		t.Fatalf("err=%v calls=%d, want nil after 3 calls", err, calls)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), failingFn(10, &calls), WithBackoff(time.Millisecond), WithMaxAttempts(4))
+	if err == nil || calls != 4 {
+		t.Fatalf("err=%v calls=%d, want an error after 4 calls", err, calls)
+	}
+
+	for _, n := range []int{0, -5} {
+		calls = 0
+		err = Retry(context.Background(), failingFn(10, &calls), WithBackoff(time.Millisecond), WithMaxAttempts(n))
+		if err == nil || calls != 1 {
+			t.Fatalf("WithMaxAttempts(%d): err=%v calls=%d, want an error after 1 call", n, err, calls)
+		}
+	}
+}
+
+func TestRetryOn(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), failingFn(10, &calls),
+		WithBackoff(time.Millisecond),
+		WithRetryOn(func(error) bool { return false }),
+	)
+	if err == nil || calls != 1 {
+		t.Fatalf("err=%v calls=%d, want an error after 1 call", err, calls)
+	}
+
+	// nil keeps the default instead of panicking
+	calls = 0
+	err = Retry(context.Background(), failingFn(1, &calls), WithBackoff(time.Millisecond), WithRetryOn(nil))
+	if err != nil || calls != 2 {
+		t.Fatalf("err=%v calls=%d, want nil after 2 calls", err, calls)
+	}
+}
+
+func TestRetryNegativeBackoffWithJitter(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), failingFn(10, &calls),
+		WithBackoff(-time.Millisecond), WithJitter(), WithMaxAttempts(2))
+	if err == nil || calls != 2 {
+		t.Fatalf("err=%v calls=%d, want an error after 2 calls", err, calls)
+	}
+}
+
+func TestRetryMaxDelay(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := Retry(context.Background(), failingFn(4, &calls),
+		WithBackoff(time.Hour), WithMaxDelay(time.Millisecond), WithJitter(), WithMaxAttempts(5))
+	if err != nil || calls != 5 {
+		t.Fatalf("err=%v calls=%d, want nil after 5 calls", err, calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("took %v, max delay not applied", elapsed)
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	delay := time.Millisecond
+	for i := 0; i < 100; i++ {
+		delay = nextDelay(delay, 50*time.Millisecond)
+		if delay <= 0 || delay > 50*time.Millisecond {
+			t.Fatalf("attempt %d: delay %v outside (0, 50ms]", i, delay)
+		}
+	}
+
+	// without a cap it saturates instead of overflowing
+	delay = time.Millisecond
+	for i := 0; i < 100; i++ {
+		delay = nextDelay(delay, 0)
+		if delay <= 0 {
+			t.Fatalf("attempt %d: delay overflowed to %v", i, delay)
+		}
+	}
+}
+
+func TestRetryContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := Retry(ctx, failingFn(10, &calls), WithBackoff(time.Hour))
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Fatalf("err=%v calls=%d, want context.Canceled after 1 call", err, calls)
+	}
+}
+
+func TestEnsureUTF8(t *testing.T) {
+	valid := []byte("héllo")
+	if got := EnsureUTF8(valid); &got[0] != &valid[0] {
+		t.Fatal("valid input should be returned untouched")
+	}
+
+	invalid := []byte("a\xffb\xc3")
+	got := EnsureUTF8(invalid)
+	if !utf8.Valid(got) || !bytes.Equal(got, []byte("a\uFFFDb\uFFFD")) {
+		t.Fatalf("got %q, want %q", got, "a\uFFFDb\uFFFD")
+	}
+
+	// a run of invalid bytes becomes a single replacement
+	if got := EnsureUTF8([]byte("a\xff\xfeb")); !bytes.Equal(got, []byte("a\uFFFDb")) {
+		t.Fatalf("got %q, want %q", got, "a\uFFFDb")
+	}
+
+	if got := EnsureUTF8(invalid, WithDropInvalid()); !bytes.Equal(got, []byte("ab")) {
+		t.Fatalf("got %q, want %q", got, "ab")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/api?apikey=secret":              "https://example.com/api?apikey=***",
+		"https://example.com/api?q=go&TOKEN=abc&page=2":      "https://example.com/api?q=go&TOKEN=***&page=2",
+		"https://example.com/api?mailto=me@example.com#frag": "https://example.com/api?mailto=***#frag",
+		"GET /api failed: Authorization: Bearer abc.def":     "GET /api failed: Authorization: ***",
+		"https://example.com/api?q=token":                    "https://example.com/api?q=token",
+	}
+	for in, want := range tests {
+		if got := redact(in); got != want {
+			t.Errorf("redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMergeAuthors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists [][]string
+		want  []string
+	}{
+		{
+			name:  "initial and full name",
+			lists: [][]string{{"J. Smith", "B. Jones"}, {"John Smith"}},
+			want:  []string{"John Smith", "B. Jones"},
+		},
+		{
+			name:  "last, first form",
+			lists: [][]string{{"Smith, J."}, {"John A. Smith"}},
+			want:  []string{"John A. Smith"},
+		},
+		{
+			name:  "exact duplicates and extra whitespace",
+			lists: [][]string{{"Alan  Donovan"}, {"alan donovan", "", "."}},
+			want:  []string{"Alan Donovan", "."},
+		},
+		{
+			name:  "distinct given names",
+			lists: [][]string{{"John Smith"}, {"Jane Smith"}},
+			want:  []string{"John Smith", "Jane Smith"},
+		},
+		{
+			name:  "distinct surnames",
+			lists: [][]string{{"J. Smith"}, {"J. Smyth"}},
+			want:  []string{"J. Smith", "J. Smyth"},
+		},
+		{
+			name:  "surname only is not merged",
+			lists: [][]string{{"Smith"}, {"John Smith"}},
+			want:  []string{"Smith", "John Smith"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeAuthors(tt.lists...); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := map[string]string{
+		"978-0-13-419044-0": "9780134190440",
+		"978 0 13 419044 0": "9780134190440",
+		"9780134190440":     "9780134190440",
+		"0-306-40615-x":     "030640615X",
+		"":                  "",
+	}
+	for in, want := range tests {
+		if got := normalizeISBN(nil, in); string(got) != want {
+			t.Errorf("normalizeISBN(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// appends to dst, doesn't overwrite it
+	if got := normalizeISBN([]byte("isbn:"), "0-306-40615-2"); string(got) != "isbn:0306406152" {
+		t.Errorf("got %q", got)
+	}
+
+	var buf [13]byte
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = normalizeISBN(buf[:0], "9780134190440")
+	})
+	if allocs != 0 {
+		t.Fatalf("got %v allocs for clean input, want 0", allocs)
+	}
+}
+
+// the naive way, for comparison
+func normalizeISBNReplaceAll(s string) string {
+	s = strings.ReplaceAll(s, "-", "")
+	s = strings.ReplaceAll(s, " ", "")
+	return strings.ToUpper(s)
+}
+
+func BenchmarkNormalizeISBN(b *testing.B) {
+	for _, in := range []string{"9780134190440", "978-0-13-419044-0"} {
+		b.Run("append/"+in, func(b *testing.B) {
+			var buf [13]byte
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = normalizeISBN(buf[:0], in)
+			}
+		})
+		b.Run("ReplaceAll/"+in, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = normalizeISBNReplaceAll(in)
+			}
+		})
+	}
+}
+
+func TestSanitizeString(t *testing.T) {
+	tests := map[string]string{
+		"  The Go\nProgramming\u00a0\u00a0Language \t": "The Go Programming Language",
+		"Object-Oriented\x00 Design":                   "Object-Oriented Design",
+		"Café\r\n\r\ncrème":                            "Café crème",
+		"\n\t\u00a0":                                   "",
+		"already clean":                                "already clean",
+	}
+	for in, want := range tests {
+		if got := sanitizeString(in); got != want {
+			t.Errorf("sanitizeString(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPoolRecoversPanic(t *testing.T) {
+	p := NewPool(context.Background(), 2, func(_ context.Context, i int) int {
+		if i == 3 {
+			panic("bad item")
+		}
+		return i
+	})
+	go func() {
+		for i := 0; i < 10; i++ {
+			p.Submit(i)
+		}
+		p.Close()
+	}()
+
+	var got []int
+	for r := range p.Results() {
+		got = append(got, r)
+	}
+	slices.Sort(got)
+	if want := []int{0, 1, 2, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	var perr *PanicError
+	if !errors.As(p.Err(), &perr) {
+		t.Fatalf("Err() = %v, want a *PanicError", p.Err())
+	}
+	if perr.Value != "bad item" || !strings.Contains(string(perr.Stack), "TestPoolRecoversPanic") {
+		t.Fatalf("got value %v, stack:\n%s", perr.Value, perr.Stack)
+	}
+}
+
+func TestSplitAuthors(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{"A. Smith; B. Jones and C. Lee", []string{"A. Smith", "B. Jones", "C. Lee"}},
+		{"Smith, John", []string{"Smith, John"}},
+		{"Smith, John; Jones, Mary", []string{"Smith, John", "Jones, Mary"}},
+		{"Smith, J., Jones, M.", []string{"Smith, J.", "Jones, M."}},
+		{"A. Smith, B. Jones", []string{"A. Smith", "B. Jones"}},
+		{"A. Smith, B. Jones, and C. Lee", []string{"A. Smith", "B. Jones", "C. Lee"}},
+		{"Martin Luther King, Jr. & Coretta Scott King", []string{"Martin Luther King, Jr.", "Coretta Scott King"}},
+		{"  Alan\nDonovan AND Brian Kernighan ", []string{"Alan Donovan", "Brian Kernighan"}},
+		{"Alexandra Anderson", []string{"Alexandra Anderson"}},
+		{" ; , ", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitAuthors(tt.raw); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitAuthors(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestEWMAConverges(t *testing.T) {
+	e := NewEWMA(0.2)
+	if e.Value() != 0 {
+		t.Fatalf("Value() = %v before any sample, want 0", e.Value())
+	}
+
+	e.Add(time.Second)
+	if e.Value() != time.Second {
+		t.Fatalf("Value() = %v after first sample, want 1s", e.Value())
+	}
+
+	// a steady 100ms input pulls the estimate down monotonically toward 100ms
+	prev := e.Value()
+	for i := 0; i < 100; i++ {
+		e.Add(100 * time.Millisecond)
+		if v := e.Value(); v > prev {
+			t.Fatalf("sample %d: value went up from %v to %v", i, prev, v)
+		}
+		prev = e.Value()
+	}
+	if diff := e.Value() - 100*time.Millisecond; diff < 0 || diff > time.Millisecond {
+		t.Fatalf("Value() = %v, want ~100ms", e.Value())
+	}
+}
+
+func TestEWMAInvalidAlpha(t *testing.T) {
+	for _, alpha := range []float64{0, -1, 2, math.NaN()} {
+		e := NewEWMA(alpha)
+		e.Add(time.Second)
+		e.Add(0)
+		// with the 0.1 default: 0.9 * 1s
+		if e.Value() != 900*time.Millisecond {
+			t.Errorf("alpha=%v: Value() = %v, want 900ms", alpha, e.Value())
+		}
+	}
+}